@@ -1,43 +1,163 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"net"
 	"os"
+	"strings"
+	"syscall"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog"
-	// forkednet "k8s.io/utils/internal/third_party/forked/golang/net"
+
+	"github.com/VivekThrivikraman-est/storeroom/pkg/arp"
+	"github.com/VivekThrivikraman-est/storeroom/pkg/ipselect"
+	"github.com/VivekThrivikraman-est/storeroom/pkg/metrics"
+	"github.com/VivekThrivikraman-est/storeroom/pkg/nodeip"
+	"github.com/VivekThrivikraman-est/storeroom/pkg/watcher"
+)
+
+type ipFamily string
+
+const (
+	familyIPv4 ipFamily = "ipv4"
+	familyIPv6 ipFamily = "ipv6"
+	familyDual ipFamily = "dual"
 )
 
-// var ParseIPSloppy = forkednet.ParseIP
-var CIDR string
+var (
+	// clusterCIDRs holds every --cluster-cidrs entry, v4 and v6 mixed; a
+	// detected IP is only ever matched against CIDRs of its own family.
+	clusterCIDRs []*net.IPNet
+	family       ipFamily
+
+	// nodeIPGetter cross-checks local interfaces against the Kubernetes
+	// API's view of this node's IPs. It stays nil (cross-check skipped)
+	// when we're not running in-cluster.
+	nodeIPGetter *nodeip.Getter
+
+	// boundIface is the interface whose bound addresses are subtracted from
+	// the local set, e.g. kube-ipvs0, nodelocaldns or cilium_host.
+	boundIface string
+
+	// addrWatcher is the live, event-maintained address table every scan
+	// reads from instead of re-querying the kernel interface list.
+	addrWatcher *watcher.Watcher
+)
 
 func main() {
-	if len(os.Args) < 3 {
-		klog.Error("Pass time in milli secs to sleep and CIDR")
-		return
+	fallbackMs := flag.Int("fallback-interval-ms", 60000, "time in milliseconds between fallback scans; real detection is event-driven and this is only a safety net")
+	cidrs := flag.String("cluster-cidrs", "", "comma-separated list of cluster CIDRs (IPv4 and/or IPv6)")
+	ipFamilyFlag := flag.String("ip-family", string(familyDual), "address family to check: ipv4, ipv6 or dual")
+	ifaceFlag := flag.String("bound-iface", "kube-ipvs0", "interface whose bound addresses are excluded from the diff, e.g. kube-ipvs0, nodelocaldns, cilium_host")
+	listen := flag.String("listen", ":9273", "address to serve /metrics, /healthz and /readyz on")
+	primaryOnly := flag.Bool("primary-only", false, "print the RFC 6724 primary IPv4 and IPv6 address and exit, instead of running the monitor loop")
+	flag.Parse()
+
+	boundIface = *ifaceFlag
+
+	family = ipFamily(*ipFamilyFlag)
+	switch family {
+	case familyIPv4, familyIPv6, familyDual:
+	default:
+		klog.Errorf("invalid --ip-family %q, must be one of ipv4, ipv6, dual", *ipFamilyFlag)
+		os.Exit(1)
+	}
+
+	var err error
+	clusterCIDRs, err = parseCIDRs(*cidrs)
+	if err != nil {
+		klog.Error("Could not parse --cluster-cidrs, error:", err)
+		os.Exit(1)
 	}
-	sleepTime := os.Args[1] + "ms"
-	CIDR = os.Args[2]
-	duration, err := time.ParseDuration(sleepTime)
+
+	w, err := watcher.New()
 	if err != nil {
-		klog.Error("Failed to parse time:", err)
+		klog.Error("could not start address watcher:", err)
+		os.Exit(1)
+	}
+	addrWatcher = w
+
+	if *primaryOnly {
+		printPrimaryAddresses()
 		return
 	}
-	for {
-		ips, err := fetchNodeIPs()
+
+	if getter, err := nodeip.NewGetter(make(chan struct{})); err != nil {
+		klog.Errorf("Node API cross-check disabled: %v", err)
+	} else {
+		nodeIPGetter = getter
+	}
+
+	go func() {
+		if err := metrics.Serve(*listen); err != nil {
+			klog.Error("metrics server exited:", err)
+		}
+	}()
+
+	ctx := context.Background()
+	scan := func() {
+		ips, err := fetchNodeIPs(ctx)
 		if err != nil {
 			klog.Error("fetching Node Ips failed:", err)
 		} else {
 			klog.Error("Node IPs:", ips)
 		}
-		time.Sleep(duration)
+	}
+	scan()
+
+	fallbackInterval := time.Duration(*fallbackMs) * time.Millisecond
+	if err := w.Run(make(chan struct{}), fallbackInterval, scan); err != nil {
+		klog.Error("address watcher stopped:", err)
+		os.Exit(1)
 	}
 }
 
-func fetchNodeIPs() (ips []net.IP, err error) {
+// parseCIDRs splits a comma-separated list of (possibly mixed-family) CIDRs
+// into their net.IPNet form.
+func parseCIDRs(raw string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range strings.Split(raw, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		_, ipnet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %v", s, err)
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets, nil
+}
+
+// printPrimaryAddresses prints the RFC 6724 primary IPv4 and IPv6 address
+// for this node, one per line, for scripts that today grep the klog output.
+func printPrimaryAddresses() {
+	addrs, err := getAllLocalAddresses()
+	if err != nil {
+		klog.Error("could not list local addresses:", err)
+		os.Exit(1)
+	}
+	var ips []net.IP
+	for _, s := range addrs.UnsortedList() {
+		if ip := ParseIP(s); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	if v4 := ipselect.SelectPrimary(ips, syscall.AF_INET); v4 != nil {
+		fmt.Println(v4)
+	}
+	if v6 := ipselect.SelectPrimary(ips, syscall.AF_INET6); v6 != nil {
+		fmt.Println(v6)
+	}
+}
+
+func fetchNodeIPs(ctx context.Context) (ips []net.IP, err error) {
 	nodeAddress, err := getAllLocalAddresses()
 	if err != nil {
 		return nil, fmt.Errorf("error listing LOCAL type addresses from host, error: %v", err)
@@ -47,50 +167,195 @@ func fetchNodeIPs() (ips []net.IP, err error) {
 	if err != nil {
 		return nil, err
 	}
+	recordAddressMetrics(nodeAddress, bindedAddress)
 	ipset := nodeAddress.Difference(bindedAddress)
-	invalidIP := false
+
+	v4Diff := sets.NewString()
+	v6Diff := sets.NewString()
 	for _, ipStr := range ipset.UnsortedList() {
 		a := ParseIP(ipStr)
+		if a == nil {
+			continue
+		}
 		ips = append(ips, a)
-		_, ipnet, err := net.ParseCIDR(CIDR)
-		if err != nil {
-			klog.Error("Could not parse cidr, error", err)
+		if IsIPv6(a) {
+			v6Diff.Insert(ipStr)
+		} else {
+			v4Diff.Insert(ipStr)
 		}
-		if ipnet != nil && ipnet.Contains(a) && !invalidIP {
-			invalidIP = true
-			klog.Error("Node IP contains cluster ip:", a)
+		if cidr := matchingClusterCIDR(a); cidr != nil {
+			klog.Errorf("Node IP contains cluster ip: %s, cidr: %s", a, cidr)
+			metrics.IPInClusterCIDRTotal.WithLabelValues(cidr.String()).Inc()
+			recordAnomalyEvent("NodeIPInClusterCIDR", fmt.Sprintf("node IP %s falls inside cluster CIDR %s", a, cidr))
 		}
+		detectDuplicateAddress(ctx, a)
+	}
 
+	// Report the --bound-iface diff per family so a dual-stack misconfiguration
+	// on just one family isn't drowned out by a healthy other family.
+	if v4Diff.Len() > 0 {
+		klog.Errorf("IPv4 NodeAddresses: %+v,\n BindAddresses:%+v,\n Diff: %+v", nodeAddress, bindedAddress, v4Diff.List())
 	}
-	if invalidIP {
-		klog.Errorf("NodeAddresses: %+v,\n BindAddresses:%+v,\n Diff: %+v", nodeAddress, bindedAddress, ips)
+	if v6Diff.Len() > 0 {
+		klog.Errorf("IPv6 NodeAddresses: %+v,\n BindAddresses:%+v,\n Diff: %+v", nodeAddress, bindedAddress, v6Diff.List())
 	}
 
+	if nodeIPGetter != nil {
+		if err := checkAgainstNodeAPI(nodeAddress); err != nil {
+			klog.Errorf("node API cross-check failed: %v", err)
+		}
+	}
+
+	metrics.LastScanTimestampSeconds.Set(float64(time.Now().Unix()))
+
 	return ips, nil
 }
 
-func getAllLocalAddresses() (sets.String, error) {
-	addr, err := net.InterfaceAddrs()
+// checkAgainstNodeAPI flags any IP the kubelet/OVN believes belongs to this
+// node (via Status.Addresses or the primary-ifaddr annotation) but that is
+// missing from the local interface set, or that turns out to be a
+// cluster/service IP rather than a real node IP.
+func checkAgainstNodeAPI(localAddress sets.String) error {
+	authoritative, err := nodeIPGetter.AuthoritativeIPs()
 	if err != nil {
-		return nil, fmt.Errorf("Could not get addresses: %v", err)
+		return err
 	}
-	return AddressSet(isValidForSet, addr), nil
+	for _, ipStr := range authoritative.Difference(localAddress).UnsortedList() {
+		a := ParseIP(ipStr)
+		if a == nil || !isValidForSet(a) {
+			continue
+		}
+		if cidr := matchingClusterCIDR(a); cidr != nil {
+			klog.Errorf("Node API reports %s as a node IP but it falls inside cluster CIDR %s", a, cidr)
+			metrics.IPInClusterCIDRTotal.WithLabelValues(cidr.String()).Inc()
+			recordAnomalyEvent("NodeIPInClusterCIDR", fmt.Sprintf("node API reports %s as a node IP and it falls inside cluster CIDR %s", a, cidr))
+			continue
+		}
+		klog.Errorf("Node API reports %s as a node IP but it is missing from the local interface set", a)
+		recordAnomalyEvent("NodeIPMissingLocally", fmt.Sprintf("node API reports %s as a node IP but it is missing from the local interface set", a))
+	}
+	return nil
 }
 
-func bindedIPs() (sets.String, error) {
-	return GetLocalAddresses("kube-ipvs0")
+// recordAddressMetrics publishes the per-family node/bound IP counts; node
+// IPs are the local addresses not bound to the bound interface.
+func recordAddressMetrics(nodeAddress, bindedAddress sets.String) {
+	v4, v6 := 0, 0
+	for _, s := range nodeAddress.Difference(bindedAddress).UnsortedList() {
+		if IsIPv6(ParseIP(s)) {
+			v6++
+		} else {
+			v4++
+		}
+	}
+	metrics.NodeIPs.WithLabelValues(string(familyIPv4)).Set(float64(v4))
+	metrics.NodeIPs.WithLabelValues(string(familyIPv6)).Set(float64(v6))
+
+	bv4, bv6 := 0, 0
+	for _, s := range bindedAddress.UnsortedList() {
+		if IsIPv6(ParseIP(s)) {
+			bv6++
+		} else {
+			bv4++
+		}
+	}
+	metrics.BoundIPs.WithLabelValues(boundIface, string(familyIPv4)).Set(float64(bv4))
+	metrics.BoundIPs.WithLabelValues(boundIface, string(familyIPv6)).Set(float64(bv6))
 }
 
-func GetLocalAddresses(dev string) (sets.String, error) {
-	ifi, err := net.InterfaceByName(dev)
+// recordAnomalyEvent surfaces an anomaly as a Kubernetes Event on the local
+// Node, when running with API access.
+func recordAnomalyEvent(reason, message string) {
+	if nodeIPGetter == nil {
+		return
+	}
+	nodeIPGetter.RecordEvent(corev1.EventTypeWarning, reason, message)
+}
+
+// matchingClusterCIDR returns the cluster CIDR of ip's own family that
+// contains ip, or nil if none does.
+func matchingClusterCIDR(ip net.IP) *net.IPNet {
+	for _, n := range clusterCIDRs {
+		if IsIPv6(ip) != (n.IP.To4() == nil) {
+			continue
+		}
+		if n.Contains(ip) {
+			return n
+		}
+	}
+	return nil
+}
+
+// detectDuplicateAddress runs an active ARP (IPv4) or NDP (IPv6) check for
+// ip on whichever interface owns it, and logs the peer's MAC if another
+// host answers for the same address. It only ever runs against addresses
+// already in the --bound-iface diff, so intentionally-shared IPs are never
+// probed.
+func detectDuplicateAddress(ctx context.Context, ip net.IP) {
+	ifi, err := ifaceForIP(ip)
 	if err != nil {
-		return nil, fmt.Errorf("Could not get interface %s: %v", dev, err)
+		klog.Errorf("could not find owning interface for %s, skipping duplicate-address check: %v", ip, err)
+		return
+	}
+
+	var conflict net.HardwareAddr
+	if IsIPv6(ip) {
+		conflict, err = arp.NdpDetectIPConflict(ctx, ifi.Name, ip, ifi.HardwareAddr, arp.DefaultConfig)
+	} else {
+		conflict, err = arp.ArpDetectIPConflict(ctx, ifi.Name, ip, ifi.HardwareAddr, arp.DefaultConfig)
+	}
+	if err != nil {
+		klog.Errorf("duplicate-address check failed for %s on %s: %v", ip, ifi.Name, err)
+		return
 	}
-	addr, err := ifi.Addrs()
+	if conflict != nil {
+		klog.Errorf("duplicate address detected: %s is also claimed by %s", ip, conflict)
+		metrics.ArpConflictsTotal.WithLabelValues(conflict.String()).Inc()
+		recordAnomalyEvent("DuplicateAddress", fmt.Sprintf("%s is also claimed by peer MAC %s", ip, conflict))
+	}
+}
+
+// ifaceForIP returns the interface that currently holds ip.
+func ifaceForIP(ip net.IP) (*net.Interface, error) {
+	ifaces, err := net.Interfaces()
 	if err != nil {
-		return nil, fmt.Errorf("Can't get addresses from %s: %v", ifi.Name, err)
+		return nil, fmt.Errorf("could not list interfaces: %v", err)
+	}
+	for i := range ifaces {
+		addrs, err := ifaces[i].Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if ok && ipnet.IP.Equal(ip) {
+				return &ifaces[i], nil
+			}
+		}
 	}
-	return AddressSet(isValidForSet, addr), nil
+	return nil, fmt.Errorf("no interface owns %s", ip)
+}
+
+// getAllLocalAddresses reads the address-watcher's maintained table rather
+// than re-querying every interface from the kernel on every scan.
+func getAllLocalAddresses() (sets.String, error) {
+	if addrWatcher == nil {
+		return nil, fmt.Errorf("address watcher not initialized")
+	}
+	return addrWatcher.Addresses(isValidForSet), nil
+}
+
+func bindedIPs() (sets.String, error) {
+	return GetLocalAddresses(boundIface)
+}
+
+// GetLocalAddresses reads the address-watcher's maintained table for dev
+// rather than re-querying the kernel on every scan.
+func GetLocalAddresses(dev string) (sets.String, error) {
+	if addrWatcher == nil {
+		return nil, fmt.Errorf("address watcher not initialized")
+	}
+	return addrWatcher.InterfaceAddresses(dev, isValidForSet)
 }
 
 func AddressSet(isValid func(ip net.IP) bool, addrs []net.Addr) sets.String {
@@ -112,14 +377,22 @@ func AddressSet(isValid func(ip net.IP) bool, addrs []net.Addr) sets.String {
 	return ips
 }
 
+// isValidForSet keeps an address unless it's loopback, an IPv6 link-local
+// address, or belongs to a family excluded by --ip-family.
 func isValidForSet(ip net.IP) bool {
-	if IsIPv6(ip) {
+	if ip.IsLoopback() {
 		return false
 	}
-	// if h.isIPv6 && ip.IsLinkLocalUnicast() {
-	// 	return false
-	// }
-	if ip.IsLoopback() {
+	if IsIPv6(ip) {
+		if family == familyIPv4 {
+			return false
+		}
+		if ip.IsLinkLocalUnicast() {
+			return false
+		}
+		return true
+	}
+	if family == familyIPv6 {
 		return false
 	}
 	return true
@@ -129,3 +402,8 @@ func IsIPv6(netIP net.IP) bool {
 	return netIP != nil && netIP.To4() == nil
 }
 
+// ParseIP parses the dotted-quad or colon-separated string form produced by
+// AddressSet back into a net.IP, preserving whichever family it was.
+func ParseIP(s string) net.IP {
+	return net.ParseIP(s)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseCIDRsMixedFamily(t *testing.T) {
+	nets, err := parseCIDRs("10.0.0.0/8, 2001:db8::/32,,192.168.0.0/16")
+	if err != nil {
+		t.Fatalf("parseCIDRs() error = %v", err)
+	}
+	if len(nets) != 3 {
+		t.Fatalf("parseCIDRs() returned %d nets, want 3", len(nets))
+	}
+	want := []string{"10.0.0.0/8", "2001:db8::/32", "192.168.0.0/16"}
+	for i, n := range nets {
+		if n.String() != want[i] {
+			t.Errorf("nets[%d] = %s, want %s", i, n, want[i])
+		}
+	}
+}
+
+func TestParseCIDRsEmpty(t *testing.T) {
+	nets, err := parseCIDRs("")
+	if err != nil {
+		t.Fatalf("parseCIDRs(\"\") error = %v", err)
+	}
+	if len(nets) != 0 {
+		t.Errorf("parseCIDRs(\"\") = %v, want empty", nets)
+	}
+}
+
+func TestParseCIDRsInvalid(t *testing.T) {
+	if _, err := parseCIDRs("not-a-cidr"); err == nil {
+		t.Error("parseCIDRs(\"not-a-cidr\") returned nil error, want an error")
+	}
+}
+
+func TestMatchingClusterCIDRRespectsFamily(t *testing.T) {
+	_, v4Net, _ := net.ParseCIDR("10.0.0.0/8")
+	_, v6Net, _ := net.ParseCIDR("2001:db8::/32")
+	old := clusterCIDRs
+	clusterCIDRs = []*net.IPNet{v4Net, v6Net}
+	t.Cleanup(func() { clusterCIDRs = old })
+
+	if got := matchingClusterCIDR(net.ParseIP("10.1.2.3")); got != v4Net {
+		t.Errorf("matchingClusterCIDR(v4 in v4 CIDR) = %v, want %s", got, v4Net)
+	}
+	if got := matchingClusterCIDR(net.ParseIP("2001:db8::1")); got != v6Net {
+		t.Errorf("matchingClusterCIDR(v6 in v6 CIDR) = %v, want %s", got, v6Net)
+	}
+	// A v4 address must never match a v6 CIDR and vice versa, even though
+	// net.IPNet.Contains alone wouldn't enforce that.
+	if got := matchingClusterCIDR(net.ParseIP("10.1.2.3")); got == v6Net {
+		t.Errorf("matchingClusterCIDR(v4) = %v, want it not to match the v6 CIDR", got)
+	}
+	if got := matchingClusterCIDR(net.ParseIP("2001:db8::1")); got == v4Net {
+		t.Errorf("matchingClusterCIDR(v6) = %v, want it not to match the v4 CIDR", got)
+	}
+	if got := matchingClusterCIDR(net.ParseIP("192.0.2.1")); got != nil {
+		t.Errorf("matchingClusterCIDR(non-matching v4) = %v, want nil", got)
+	}
+}
+
+func TestIsValidForSetByFamily(t *testing.T) {
+	oldFamily := family
+	t.Cleanup(func() { family = oldFamily })
+
+	v4 := net.ParseIP("192.0.2.1")
+	v6 := net.ParseIP("2001:db8::1")
+	v6LinkLocal := net.ParseIP("fe80::1")
+	loopback := net.ParseIP("127.0.0.1")
+
+	family = familyDual
+	if !isValidForSet(v4) {
+		t.Error("isValidForSet(v4) under dual = false, want true")
+	}
+	if !isValidForSet(v6) {
+		t.Error("isValidForSet(v6) under dual = false, want true")
+	}
+	if isValidForSet(v6LinkLocal) {
+		t.Error("isValidForSet(v6 link-local) under dual = true, want false")
+	}
+	if isValidForSet(loopback) {
+		t.Error("isValidForSet(loopback) under dual = true, want false")
+	}
+
+	family = familyIPv4
+	if !isValidForSet(v4) {
+		t.Error("isValidForSet(v4) under ipv4 = false, want true")
+	}
+	if isValidForSet(v6) {
+		t.Error("isValidForSet(v6) under ipv4 = true, want false")
+	}
+
+	family = familyIPv6
+	if isValidForSet(v4) {
+		t.Error("isValidForSet(v4) under ipv6 = true, want false")
+	}
+	if !isValidForSet(v6) {
+		t.Error("isValidForSet(v6) under ipv6 = false, want true")
+	}
+}
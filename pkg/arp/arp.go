@@ -0,0 +1,190 @@
+// Package arp implements an active duplicate-address check for IPv4: it
+// sends a gratuitous ARP request for a node IP out of its owning interface,
+// claiming our own MAC as the sender, and treats any reply carrying a
+// different sender MAC as a conflicting node advertising the same address.
+package arp
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	ethernetHeaderLen = 14
+	arpPacketLen      = 28
+	ethTypeARP        = 0x0806
+
+	arpHTypeEthernet = 1
+	arpPTypeIPv4     = 0x0800
+	arpHLenEthernet  = 6
+	arpPLenIPv4      = 4
+	arpOpRequest     = 1
+	arpOpReply       = 2
+)
+
+// Config tunes the conflict check's retry/timeout budget so calling it for
+// every IP in a diff set doesn't turn into an ARP/NDP storm.
+type Config struct {
+	Timeout time.Duration
+	Retries int
+	// MinInterval is the minimum time between probes of the same
+	// (interface, IP) pair. A probe requested before MinInterval has
+	// elapsed since the last one is skipped (reported as "no conflict")
+	// rather than sent, so a flapping interface can't be turned into a
+	// storm by repeated rescans.
+	MinInterval time.Duration
+}
+
+// DefaultConfig is a conservative budget suitable for scanning a handful of
+// node IPs per pass.
+var DefaultConfig = Config{Timeout: 500 * time.Millisecond, Retries: 2, MinInterval: 30 * time.Second}
+
+var (
+	lastProbeMu sync.Mutex
+	lastProbe   = map[string]time.Time{}
+)
+
+// shouldProbe reports whether key (typically "<nic>|<ip>") is due for
+// another probe, and records the attempt if so.
+func shouldProbe(key string, minInterval time.Duration) bool {
+	if minInterval <= 0 {
+		return true
+	}
+	lastProbeMu.Lock()
+	defer lastProbeMu.Unlock()
+	if t, ok := lastProbe[key]; ok && time.Since(t) < minInterval {
+		return false
+	}
+	lastProbe[key] = time.Now()
+	return true
+}
+
+// ArpDetectIPConflict sends a gratuitous ARP request for ip (claiming mac as
+// the sender hardware address) out of nic, and waits for a reply whose
+// sender MAC differs from ours. It returns the conflicting MAC, or nil if no
+// conflict was seen within cfg's timeout/retry budget - a plain timeout is
+// success (no conflict), not an error. ctx cancellation aborts between
+// retries.
+func ArpDetectIPConflict(ctx context.Context, nic string, ip net.IP, mac net.HardwareAddr, cfg Config) (net.HardwareAddr, error) {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return nil, fmt.Errorf("arp: %s is not an IPv4 address", ip)
+	}
+	if len(mac) != 6 {
+		return nil, fmt.Errorf("arp: mac %s is not a 6-byte Ethernet address", mac)
+	}
+	if !shouldProbe(nic+"|"+ip4.String(), cfg.MinInterval) {
+		return nil, nil
+	}
+
+	ifi, err := net.InterfaceByName(nic)
+	if err != nil {
+		return nil, fmt.Errorf("arp: could not look up interface %s: %v", nic, err)
+	}
+
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, int(htons(ethTypeARP)))
+	if err != nil {
+		return nil, fmt.Errorf("arp: could not open AF_PACKET socket: %v", err)
+	}
+	defer unix.Close(fd)
+
+	sll := &unix.SockaddrLinklayer{
+		Protocol: htons(ethTypeARP),
+		Ifindex:  ifi.Index,
+		Halen:    arpHLenEthernet,
+	}
+	copy(sll.Addr[:], broadcastMAC)
+	if err := unix.Bind(fd, sll); err != nil {
+		return nil, fmt.Errorf("arp: could not bind to %s: %v", nic, err)
+	}
+	timeval := durationToTimeval(cfg.Timeout)
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &timeval); err != nil {
+		return nil, fmt.Errorf("arp: could not set read timeout on %s: %v", nic, err)
+	}
+
+	frame := buildGratuitousRequest(mac, ip4)
+	buf := make([]byte, ethernetHeaderLen+arpPacketLen)
+
+	for attempt := 0; attempt <= cfg.Retries; attempt++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err := unix.Sendto(fd, frame, 0, sll); err != nil {
+			return nil, fmt.Errorf("arp: could not send gratuitous request on %s: %v", nic, err)
+		}
+		deadline := time.Now().Add(cfg.Timeout)
+		for time.Now().Before(deadline) {
+			n, _, err := unix.Recvfrom(fd, buf, 0)
+			if err != nil {
+				break // timed out; fall through to the next attempt
+			}
+			if conflictMAC, ok := conflictingSender(buf[:n], ip4, mac); ok {
+				return conflictMAC, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+var broadcastMAC = net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+// buildGratuitousRequest builds a full Ethernet+ARP frame announcing that ip
+// belongs to mac: both sender and target protocol addresses are ip, per the
+// usual gratuitous-ARP convention.
+func buildGratuitousRequest(mac net.HardwareAddr, ip4 net.IP) []byte {
+	frame := make([]byte, ethernetHeaderLen+arpPacketLen)
+
+	copy(frame[0:6], broadcastMAC)
+	copy(frame[6:12], mac)
+	binary.BigEndian.PutUint16(frame[12:14], ethTypeARP)
+
+	arp := frame[ethernetHeaderLen:]
+	binary.BigEndian.PutUint16(arp[0:2], arpHTypeEthernet)
+	binary.BigEndian.PutUint16(arp[2:4], arpPTypeIPv4)
+	arp[4] = arpHLenEthernet
+	arp[5] = arpPLenIPv4
+	binary.BigEndian.PutUint16(arp[6:8], arpOpRequest)
+	copy(arp[8:14], mac)
+	copy(arp[14:18], ip4)
+	// THA is left zeroed: unknown, we're asking for it.
+	copy(arp[24:28], ip4)
+
+	return frame
+}
+
+// conflictingSender reports whether frame is an ARP reply for ip4 whose
+// sender hardware address differs from ours.
+func conflictingSender(frame []byte, ip4 net.IP, ourMAC net.HardwareAddr) (net.HardwareAddr, bool) {
+	if len(frame) < ethernetHeaderLen+arpPacketLen {
+		return nil, false
+	}
+	if binary.BigEndian.Uint16(frame[12:14]) != ethTypeARP {
+		return nil, false
+	}
+	arp := frame[ethernetHeaderLen:]
+	if binary.BigEndian.Uint16(arp[6:8]) != arpOpReply {
+		return nil, false
+	}
+	if !net.IP(arp[14:18]).Equal(ip4) {
+		return nil, false
+	}
+	sender := net.HardwareAddr(append([]byte(nil), arp[8:14]...))
+	if sender.String() == ourMAC.String() {
+		return nil, false
+	}
+	return sender, true
+}
+
+func htons(v uint16) uint16 {
+	return (v<<8)&0xff00 | v>>8
+}
+
+func durationToTimeval(d time.Duration) unix.Timeval {
+	return unix.NsecToTimeval(d.Nanoseconds())
+}
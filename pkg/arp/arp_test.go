@@ -0,0 +1,93 @@
+package arp
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBuildGratuitousRequest(t *testing.T) {
+	mac := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	ip4 := net.ParseIP("192.0.2.1").To4()
+
+	frame := buildGratuitousRequest(mac, ip4)
+	if len(frame) != ethernetHeaderLen+arpPacketLen {
+		t.Fatalf("len(frame) = %d, want %d", len(frame), ethernetHeaderLen+arpPacketLen)
+	}
+	if binary.BigEndian.Uint16(frame[12:14]) != ethTypeARP {
+		t.Errorf("ethertype = %#x, want %#x", binary.BigEndian.Uint16(frame[12:14]), ethTypeARP)
+	}
+	arpBody := frame[ethernetHeaderLen:]
+	if binary.BigEndian.Uint16(arpBody[6:8]) != arpOpRequest {
+		t.Errorf("op = %d, want %d", binary.BigEndian.Uint16(arpBody[6:8]), arpOpRequest)
+	}
+	if sender := net.HardwareAddr(arpBody[8:14]); sender.String() != mac.String() {
+		t.Errorf("sender hw addr = %s, want %s", sender, mac)
+	}
+	if sha := net.IP(arpBody[14:18]); !sha.Equal(ip4) {
+		t.Errorf("sender protocol addr = %s, want %s", sha, ip4)
+	}
+	if tpa := net.IP(arpBody[24:28]); !tpa.Equal(ip4) {
+		t.Errorf("target protocol addr = %s, want %s", tpa, ip4)
+	}
+}
+
+func TestConflictingSender(t *testing.T) {
+	ourMAC := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	otherMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	ip4 := net.ParseIP("192.0.2.1").To4()
+
+	reply := buildGratuitousRequest(otherMAC, ip4)
+	arpBody := reply[ethernetHeaderLen:]
+	binary.BigEndian.PutUint16(arpBody[6:8], arpOpReply)
+
+	conflict, ok := conflictingSender(reply, ip4, ourMAC)
+	if !ok {
+		t.Fatal("conflictingSender() = false, want true")
+	}
+	if conflict.String() != otherMAC.String() {
+		t.Errorf("conflict mac = %s, want %s", conflict, otherMAC)
+	}
+
+	// A reply carrying our own MAC is not a conflict.
+	self := buildGratuitousRequest(ourMAC, ip4)
+	selfBody := self[ethernetHeaderLen:]
+	binary.BigEndian.PutUint16(selfBody[6:8], arpOpReply)
+	if _, ok := conflictingSender(self, ip4, ourMAC); ok {
+		t.Error("conflictingSender() = true for our own MAC, want false")
+	}
+
+	// A request (not a reply) is never a conflict.
+	request := buildGratuitousRequest(otherMAC, ip4)
+	if _, ok := conflictingSender(request, ip4, ourMAC); ok {
+		t.Error("conflictingSender() = true for an ARP request, want false")
+	}
+}
+
+func TestArpDetectIPConflictRejectsShortMAC(t *testing.T) {
+	mac := net.HardwareAddr{0x00, 0x11, 0x22}
+	ip := net.ParseIP("192.0.2.1")
+	if _, err := ArpDetectIPConflict(nil, "lo", ip, mac, DefaultConfig); err == nil {
+		t.Error("ArpDetectIPConflict() with a 3-byte MAC returned nil error, want an error")
+	}
+}
+
+func TestShouldProbe(t *testing.T) {
+	key := "test-key-should-probe"
+	t.Cleanup(func() {
+		lastProbeMu.Lock()
+		delete(lastProbe, key)
+		lastProbeMu.Unlock()
+	})
+
+	if !shouldProbe(key, time.Minute) {
+		t.Fatal("first shouldProbe() = false, want true")
+	}
+	if shouldProbe(key, time.Minute) {
+		t.Error("second shouldProbe() within MinInterval = true, want false")
+	}
+	if !shouldProbe(key, 0) {
+		t.Error("shouldProbe() with MinInterval 0 = false, want true (rate limiting disabled)")
+	}
+}
@@ -0,0 +1,144 @@
+package arp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+)
+
+// NdpDetectIPConflict is the IPv6 equivalent of ArpDetectIPConflict: it sends
+// an ICMPv6 Neighbor Solicitation for ip out of nic with a Source
+// Link-Layer Address option set to mac, and treats a Neighbor Advertisement
+// carrying a different link-layer address as a conflict. ctx cancellation
+// aborts between retries.
+func NdpDetectIPConflict(ctx context.Context, nic string, ip net.IP, mac net.HardwareAddr, cfg Config) (net.HardwareAddr, error) {
+	ip6 := ip.To16()
+	if ip6 == nil || ip.To4() != nil {
+		return nil, fmt.Errorf("ndp: %s is not an IPv6 address", ip)
+	}
+	if len(mac) != 6 {
+		return nil, fmt.Errorf("ndp: mac %s is not a 6-byte Ethernet address", mac)
+	}
+	if !shouldProbe(nic+"|"+ip6.String(), cfg.MinInterval) {
+		return nil, nil
+	}
+
+	ifi, err := net.InterfaceByName(nic)
+	if err != nil {
+		return nil, fmt.Errorf("ndp: could not look up interface %s: %v", nic, err)
+	}
+
+	conn, err := icmp.ListenPacket("ip6:ipv6-icmp", "::")
+	if err != nil {
+		return nil, fmt.Errorf("ndp: could not open ICMPv6 socket: %v", err)
+	}
+	defer conn.Close()
+
+	pc := conn.IPv6PacketConn()
+	if err := pc.SetMulticastInterface(ifi); err != nil {
+		return nil, fmt.Errorf("ndp: could not bind multicast interface %s: %v", nic, err)
+	}
+	if err := pc.SetHopLimit(255); err != nil {
+		return nil, fmt.Errorf("ndp: could not set hop limit: %v", err)
+	}
+
+	solicited := solicitedNodeMulticast(ip6)
+	msg := buildNeighborSolicitation(ip6, mac)
+
+	buf := make([]byte, 256)
+	for attempt := 0; attempt <= cfg.Retries; attempt++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if _, err := pc.WriteTo(msg, nil, &net.IPAddr{IP: solicited, Zone: ifi.Name}); err != nil {
+			return nil, fmt.Errorf("ndp: could not send neighbor solicitation on %s: %v", nic, err)
+		}
+		deadline := time.Now().Add(cfg.Timeout)
+		for time.Now().Before(deadline) {
+			if err := conn.SetReadDeadline(deadline); err != nil {
+				return nil, fmt.Errorf("ndp: could not set read deadline: %v", err)
+			}
+			n, _, _, err := pc.ReadFrom(buf)
+			if err != nil {
+				break // timed out; fall through to the next attempt
+			}
+			if conflictMAC, ok := conflictingAdvertiser(buf[:n], ip6, mac); ok {
+				return conflictMAC, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// solicitedNodeMulticast derives the solicited-node multicast address
+// (ff02::1:ffXX:XXXX) for ip6, the destination NDP queries for an address
+// are conventionally sent to.
+func solicitedNodeMulticast(ip6 net.IP) net.IP {
+	solicited := net.ParseIP("ff02::1:ff00:0")
+	copy(solicited[13:], ip6[13:])
+	return solicited
+}
+
+// Neighbor Discovery option/message constants (RFC 4861).
+const (
+	ndpOptSourceLinkLayerAddr = 1
+	ndpOptTargetLinkLayerAddr = 2
+)
+
+func buildNeighborSolicitation(target net.IP, mac net.HardwareAddr) []byte {
+	// ICMPv6 Neighbor Solicitation body: 4 reserved bytes + 16-byte target
+	// address, followed by a Source Link-Layer Address option (type 1,
+	// length 1 == 8 bytes, padded MAC).
+	body := make([]byte, 4+16)
+	copy(body[4:20], target)
+	body = append(body, ndpOptSourceLinkLayerAddr, 1)
+	body = append(body, mac...)
+
+	m := icmp.Message{
+		Type: ipv6.ICMPTypeNeighborSolicitation,
+		Code: 0,
+		Body: &icmp.RawBody{Data: body},
+	}
+	out, err := m.Marshal(nil)
+	if err != nil {
+		// Marshal only fails on an invalid body for the given type, which
+		// can't happen for a well-formed RawBody.
+		panic(err)
+	}
+	return out
+}
+
+// conflictingAdvertiser reports whether pkt is a Neighbor Advertisement for
+// target whose Target Link-Layer Address option differs from ourMAC.
+func conflictingAdvertiser(pkt []byte, target net.IP, ourMAC net.HardwareAddr) (net.HardwareAddr, bool) {
+	rm, err := icmp.ParseMessage(58, pkt) // 58 == IPPROTO_ICMPV6
+	if err != nil || rm.Type != ipv6.ICMPTypeNeighborAdvertisement {
+		return nil, false
+	}
+	body, ok := rm.Body.(*icmp.RawBody)
+	if !ok || len(body.Data) < 20 {
+		return nil, false
+	}
+	if !net.IP(body.Data[4:20]).Equal(target) {
+		return nil, false
+	}
+	for opts := body.Data[20:]; len(opts) >= 8; {
+		optType, optLen := opts[0], int(opts[1])*8
+		if optLen == 0 || optLen > len(opts) {
+			break
+		}
+		if optType == ndpOptTargetLinkLayerAddr {
+			lladdr := net.HardwareAddr(append([]byte(nil), opts[2:8]...))
+			if lladdr.String() != ourMAC.String() {
+				return lladdr, true
+			}
+			return nil, false
+		}
+		opts = opts[optLen:]
+	}
+	return nil, false
+}
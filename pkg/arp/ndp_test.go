@@ -0,0 +1,60 @@
+package arp
+
+import (
+	"net"
+	"testing"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+)
+
+func buildNeighborAdvertisement(target net.IP, lladdr net.HardwareAddr) []byte {
+	body := make([]byte, 4+16)
+	copy(body[4:20], target.To16())
+	body = append(body, ndpOptTargetLinkLayerAddr, 1)
+	body = append(body, lladdr...)
+
+	m := icmp.Message{
+		Type: ipv6.ICMPTypeNeighborAdvertisement,
+		Code: 0,
+		Body: &icmp.RawBody{Data: body},
+	}
+	out, err := m.Marshal(nil)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func TestConflictingAdvertiser(t *testing.T) {
+	ourMAC := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	otherMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	target := net.ParseIP("2001:db8::1")
+
+	pkt := buildNeighborAdvertisement(target, otherMAC)
+	conflict, ok := conflictingAdvertiser(pkt, target, ourMAC)
+	if !ok {
+		t.Fatal("conflictingAdvertiser() = false, want true")
+	}
+	if conflict.String() != otherMAC.String() {
+		t.Errorf("conflict mac = %s, want %s", conflict, otherMAC)
+	}
+
+	selfPkt := buildNeighborAdvertisement(target, ourMAC)
+	if _, ok := conflictingAdvertiser(selfPkt, target, ourMAC); ok {
+		t.Error("conflictingAdvertiser() = true for our own link-layer address, want false")
+	}
+
+	otherTarget := net.ParseIP("2001:db8::2")
+	if _, ok := conflictingAdvertiser(pkt, otherTarget, ourMAC); ok {
+		t.Error("conflictingAdvertiser() = true for a non-matching target, want false")
+	}
+}
+
+func TestNdpDetectIPConflictRejectsShortMAC(t *testing.T) {
+	mac := net.HardwareAddr{0x00, 0x11, 0x22}
+	ip := net.ParseIP("2001:db8::1")
+	if _, err := NdpDetectIPConflict(nil, "lo", ip, mac, DefaultConfig); err == nil {
+		t.Error("NdpDetectIPConflict() with a 3-byte MAC returned nil error, want an error")
+	}
+}
@@ -0,0 +1,240 @@
+// Package ipselect picks a single canonical "primary" address out of an
+// unordered candidate set, following the destination/source address
+// selection rules of RFC 6724 §2.1.
+//
+// net.IP carries no lifetime state, so the RFC's "avoid deprecated
+// addresses" rule is a no-op here - every candidate is assumed valid.
+package ipselect
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"syscall"
+)
+
+// policyEntry is one row of the RFC 6724 §2.1 default policy table.
+type policyEntry struct {
+	prefix     *net.IPNet
+	label      int
+	precedence int
+}
+
+// policyTable mirrors the default policy table from RFC 6724 §2.1, using
+// the label numbers called out for this tool's supported prefixes. The
+// table's 2001::/32 (Teredo) row is not included, so those addresses fall
+// under ::/0.
+var policyTable = mustBuildPolicyTable([]struct {
+	cidr       string
+	label      int
+	precedence int
+}{
+	{"::1/128", 0, 50},
+	{"::/0", 1, 40},
+	{"2002::/16", 2, 30},
+	{"::/96", 3, 20},
+	{"::ffff:0:0/96", 4, 10},
+	{"fc00::/7", 13, 3},
+	{"fec0::/10", 11, 1},
+	{"3ffe::/16", 12, 1},
+})
+
+func mustBuildPolicyTable(rows []struct {
+	cidr       string
+	label      int
+	precedence int
+}) []policyEntry {
+	table := make([]policyEntry, 0, len(rows))
+	for _, r := range rows {
+		_, ipnet, err := net.ParseCIDR(r.cidr)
+		if err != nil {
+			panic(err)
+		}
+		table = append(table, policyEntry{prefix: ipnet, label: r.label, precedence: r.precedence})
+	}
+	return table
+}
+
+// classify returns the (label, precedence) of ip's longest-matching entry in
+// policyTable. Entries are tried longest-prefix-first since ::/0 would
+// otherwise shadow everything else.
+func classify(ip net.IP) (label, precedence int) {
+	ip16 := ip.To16()
+	var best *policyEntry
+	bestOnes := -1
+	for i := range policyTable {
+		e := &policyTable[i]
+		if !e.prefix.Contains(ip16) {
+			continue
+		}
+		ones, _ := e.prefix.Mask.Size()
+		if ones > bestOnes {
+			bestOnes = ones
+			best = e
+		}
+	}
+	if best == nil {
+		return 1, 40 // RFC 6724's ::/0 row: matches everything else.
+	}
+	return best.label, best.precedence
+}
+
+// scope returns a smaller-is-narrower RFC 6724-ish scope value so global
+// addresses outrank link-local/site-local ones when there's no destination
+// to match scopes against.
+func scope(ip net.IP) int {
+	switch {
+	case ip.IsLoopback():
+		return 1
+	case ip.IsLinkLocalUnicast(), ip.IsLinkLocalMulticast():
+		return 2
+	case ip.IsPrivate():
+		return 5
+	default:
+		return 14
+	}
+}
+
+func addrFamily(ip net.IP) int {
+	if ip.To4() != nil {
+		return syscall.AF_INET
+	}
+	return syscall.AF_INET6
+}
+
+// SelectPrimary returns the best candidate of the given family
+// (syscall.AF_INET or syscall.AF_INET6) from ips, per RFC 6724 §2.1 with no
+// destination in mind: prefer larger scope, then higher policy-table
+// precedence, with a stable tiebreak on the raw address bytes. Returns nil
+// if no candidate matches family.
+func SelectPrimary(ips []net.IP, family int) net.IP {
+	return selectPrimary(ips, family, nil)
+}
+
+// SelectPrimaryFor is like SelectPrimary but ranks candidates against dest:
+// it prefers the narrowest scope that still reaches dest (rule 2), then a
+// matching policy-table label (rule 3), then higher precedence (rule 4),
+// then the longest shared address prefix with dest (rule 8), with a stable
+// tiebreak on the raw address bytes.
+func SelectPrimaryFor(ips []net.IP, family int, dest net.IP) net.IP {
+	return selectPrimary(ips, family, dest)
+}
+
+type scored struct {
+	ip    net.IP
+	scope int
+	label int
+	prec  int
+}
+
+func selectPrimary(ips []net.IP, family int, dest net.IP) net.IP {
+	var candidates []scored
+	for _, ip := range ips {
+		if addrFamily(ip) != family {
+			continue
+		}
+		label, prec := classify(ip)
+		candidates = append(candidates, scored{ip: ip, scope: scope(ip), label: label, prec: prec})
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	haveDest := dest != nil
+	var destScope, destLabel int
+	if haveDest {
+		destScope = scope(dest)
+		destLabel, _ = classify(dest)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+
+		if c := compareScope(a.scope, b.scope, destScope, haveDest); c != 0 {
+			return c < 0
+		}
+
+		if haveDest {
+			if aMatch, bMatch := a.label == destLabel, b.label == destLabel; aMatch != bMatch {
+				return aMatch
+			}
+		}
+
+		if a.prec != b.prec {
+			return a.prec > b.prec
+		}
+
+		if haveDest {
+			if ca, cb := commonPrefixLen(a.ip, dest), commonPrefixLen(b.ip, dest); ca != cb {
+				return ca > cb
+			}
+		}
+
+		return bytes.Compare(a.ip.To16(), b.ip.To16()) < 0
+	})
+	return candidates[0].ip
+}
+
+// compareScope orders two candidate scopes. With no destination, broader
+// (more global) scope always wins. With a destination, a scope that covers
+// the destination beats one that doesn't, and among those that cover it the
+// narrowest (closest) one wins, matching RFC 6724 rule 2.
+func compareScope(a, b, dest int, haveDest bool) int {
+	if !haveDest {
+		switch {
+		case a > b:
+			return -1
+		case a < b:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	aCovers, bCovers := a >= dest, b >= dest
+	switch {
+	case aCovers && !bCovers:
+		return -1
+	case !aCovers && bCovers:
+		return 1
+	case aCovers && bCovers:
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		default:
+			return 0
+		}
+	default:
+		switch {
+		case a > b:
+			return -1
+		case a < b:
+			return 1
+		default:
+			return 0
+		}
+	}
+}
+
+func commonPrefixLen(a, b net.IP) int {
+	a16, b16 := a.To16(), b.To16()
+	if a16 == nil || b16 == nil {
+		return 0
+	}
+	n := 0
+	for i := range a16 {
+		x := a16[i] ^ b16[i]
+		if x == 0 {
+			n += 8
+			continue
+		}
+		for x&0x80 == 0 {
+			n++
+			x <<= 1
+		}
+		break
+	}
+	return n
+}
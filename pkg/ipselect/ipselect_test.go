@@ -0,0 +1,78 @@
+package ipselect
+
+import (
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		ip            string
+		wantLabel     int
+		wantPrecedent int
+	}{
+		{"::1", 0, 50},
+		{"2001:db8::1", 1, 40},
+		{"::ffff:192.0.2.1", 4, 10},
+		{"fc00::1", 13, 3},
+		{"fec0::1", 11, 1},
+	}
+	for _, c := range cases {
+		label, prec := classify(net.ParseIP(c.ip))
+		if label != c.wantLabel || prec != c.wantPrecedent {
+			t.Errorf("classify(%s) = (%d, %d), want (%d, %d)", c.ip, label, prec, c.wantLabel, c.wantPrecedent)
+		}
+	}
+}
+
+func TestSelectPrimaryPrefersGlobalScope(t *testing.T) {
+	ips := []net.IP{
+		net.ParseIP("fe80::1"),
+		net.ParseIP("2001:db8::1"),
+	}
+	got := SelectPrimary(ips, syscall.AF_INET6)
+	want := net.ParseIP("2001:db8::1")
+	if !got.Equal(want) {
+		t.Errorf("SelectPrimary() = %s, want %s", got, want)
+	}
+}
+
+func TestSelectPrimaryForPrefersMatchingScopeOverGlobal(t *testing.T) {
+	// A link-local destination should prefer a link-local source over a
+	// global one, per RFC 6724 rule 2 - the opposite of the no-destination
+	// default.
+	ips := []net.IP{
+		net.ParseIP("2001:db8::1"),
+		net.ParseIP("fe80::1"),
+	}
+	dest := net.ParseIP("fe80::2")
+	got := SelectPrimaryFor(ips, syscall.AF_INET6, dest)
+	want := net.ParseIP("fe80::1")
+	if !got.Equal(want) {
+		t.Errorf("SelectPrimaryFor() = %s, want %s", got, want)
+	}
+}
+
+func TestSelectPrimaryForPrefersMatchingLabel(t *testing.T) {
+	// Both candidates land in the same ("global") scope bucket as dest, so
+	// scope alone can't decide between them; only the 6to4 candidate shares
+	// dest's label (2), so rule 3 should pick it despite its lower
+	// precedence than the plain-global candidate.
+	ips := []net.IP{
+		net.ParseIP("2001:db8::1"),
+		net.ParseIP("2002::1"),
+	}
+	dest := net.ParseIP("2002::2")
+	got := SelectPrimaryFor(ips, syscall.AF_INET6, dest)
+	want := net.ParseIP("2002::1")
+	if !got.Equal(want) {
+		t.Errorf("SelectPrimaryFor() = %s, want %s", got, want)
+	}
+}
+
+func TestSelectPrimaryNoCandidates(t *testing.T) {
+	if got := SelectPrimary(nil, syscall.AF_INET); got != nil {
+		t.Errorf("SelectPrimary(nil) = %s, want nil", got)
+	}
+}
@@ -0,0 +1,64 @@
+// Package metrics exposes the Prometheus counters/gauges this tool reports,
+// plus /healthz and /readyz for liveness/readiness probes, so anomalies are
+// alertable instead of only ever showing up as a klog line.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/klog"
+)
+
+var (
+	// NodeIPs is the number of node IPs currently detected, by family.
+	NodeIPs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "storeroom_node_ips",
+		Help: "Number of node IPs currently detected, by address family.",
+	}, []string{"family"})
+
+	// BoundIPs is the number of addresses bound to the monitored interface
+	// (e.g. kube-ipvs0), by interface and family.
+	BoundIPs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "storeroom_bound_ips",
+		Help: "Number of IPs bound to the monitored interface, by interface and address family.",
+	}, []string{"iface", "family"})
+
+	// IPInClusterCIDRTotal counts node IPs observed falling inside a cluster CIDR.
+	IPInClusterCIDRTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "storeroom_ip_in_cluster_cidr_total",
+		Help: "Count of node IPs observed falling inside a cluster CIDR, by CIDR.",
+	}, []string{"cidr"})
+
+	// ArpConflictsTotal counts ARP/NDP duplicate-address conflicts detected.
+	ArpConflictsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "storeroom_arp_conflicts_total",
+		Help: "Count of ARP/NDP duplicate-address conflicts detected, by the conflicting peer's MAC.",
+	}, []string{"peer_mac"})
+
+	// LastScanTimestampSeconds is the unix timestamp of the last completed scan.
+	LastScanTimestampSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "storeroom_last_scan_timestamp_seconds",
+		Help: "Unix timestamp of the last completed scan.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(NodeIPs, BoundIPs, IPInClusterCIDRTotal, ArpConflictsTotal, LastScanTimestampSeconds)
+}
+
+// Serve starts the /metrics, /healthz and /readyz HTTP endpoints on listen.
+// It blocks until the server exits, so callers should run it in a goroutine.
+func Serve(listen string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	klog.Infof("serving metrics on %s", listen)
+	return http.ListenAndServe(listen, mux)
+}
@@ -0,0 +1,158 @@
+// Package nodeip cross-checks the local interface address list against the
+// Kubernetes API's view of which IPs belong to this node, so that a node
+// whose kubelet only advertises one address family doesn't silently mask a
+// node IP this tool should otherwise be flagging.
+package nodeip
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+)
+
+// ovnPrimaryIfAddrAnnotation holds the per-family primary interface CIDR that
+// OVN-Kubernetes assigns the node, used as a fallback when Status.Addresses
+// is missing a family.
+const ovnPrimaryIfAddrAnnotation = "k8s.ovn.org/node-primary-ifaddr"
+
+type primaryIfAddr struct {
+	IPv4 string `json:"ipv4,omitempty"`
+	IPv6 string `json:"ipv6,omitempty"`
+}
+
+// Getter reports the set of IPs the Kubernetes API considers authoritative
+// for the local node, and can surface anomalies back to the API as Events
+// on that Node.
+type Getter struct {
+	nodeName string
+	lister   func() (*corev1.Node, error)
+	recorder record.EventRecorder
+}
+
+// NewGetter builds a Getter backed by an in-cluster client and a shared
+// informer restricted to the local node, as identified by NODE_NAME (falling
+// back to the host's own hostname).
+func NewGetter(stopCh <-chan struct{}) (*Getter, error) {
+	nodeName := os.Getenv("NODE_NAME")
+	if nodeName == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("NODE_NAME not set and could not determine hostname: %v", err)
+		}
+		nodeName = hostname
+	}
+
+	cfg, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("could not build in-cluster config: %v", err)
+	}
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not build kubernetes client: %v", err)
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 30*time.Minute,
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.FieldSelector = "metadata.name=" + nodeName
+		}),
+	)
+	nodeInformer := factory.Core().V1().Nodes()
+	informer := nodeInformer.Informer()
+	factory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+		return nil, fmt.Errorf("timed out waiting for node informer to sync")
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "storeroom"})
+
+	return &Getter{
+		nodeName: nodeName,
+		lister:   func() (*corev1.Node, error) { return nodeInformer.Lister().Get(nodeName) },
+		recorder: recorder,
+	}, nil
+}
+
+// RecordEvent emits a Kubernetes Event on the local Node object so an
+// anomaly shows up directly in `kubectl describe node`.
+func (g *Getter) RecordEvent(eventType, reason, message string) {
+	node, err := g.lister()
+	if err != nil {
+		klog.Errorf("could not get node %q to record event: %v", g.nodeName, err)
+		return
+	}
+	ref := &corev1.ObjectReference{
+		Kind: "Node",
+		Name: node.Name,
+		UID:  node.UID,
+	}
+	g.recorder.Event(ref, eventType, reason, message)
+}
+
+// AuthoritativeIPs returns the set of IPs the API server believes belong to
+// this node: first from Status.Addresses, and for any family missing there,
+// from the OVN primary-interface-address annotation.
+func (g *Getter) AuthoritativeIPs() (sets.String, error) {
+	node, err := g.lister()
+	if err != nil {
+		return nil, fmt.Errorf("could not get node %q: %v", g.nodeName, err)
+	}
+
+	ips := sets.NewString()
+	haveV4, haveV6 := false, false
+	for _, addr := range node.Status.Addresses {
+		if addr.Type != corev1.NodeInternalIP && addr.Type != corev1.NodeExternalIP {
+			continue
+		}
+		ip := net.ParseIP(addr.Address)
+		if ip == nil {
+			continue
+		}
+		ips.Insert(ip.String())
+		if ip.To4() != nil {
+			haveV4 = true
+		} else {
+			haveV6 = true
+		}
+	}
+
+	if haveV4 && haveV6 {
+		return ips, nil
+	}
+
+	raw, ok := node.Annotations[ovnPrimaryIfAddrAnnotation]
+	if !ok {
+		return ips, nil
+	}
+	var primary primaryIfAddr
+	if err := json.Unmarshal([]byte(raw), &primary); err != nil {
+		klog.Errorf("could not parse %s annotation on node %q: %v", ovnPrimaryIfAddrAnnotation, g.nodeName, err)
+		return ips, nil
+	}
+	if !haveV4 && primary.IPv4 != "" {
+		if ip, _, err := net.ParseCIDR(primary.IPv4); err == nil {
+			ips.Insert(ip.String())
+		}
+	}
+	if !haveV6 && primary.IPv6 != "" {
+		if ip, _, err := net.ParseCIDR(primary.IPv6); err == nil {
+			ips.Insert(ip.String())
+		}
+	}
+	return ips, nil
+}
@@ -0,0 +1,84 @@
+package nodeip
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func getterFor(node *corev1.Node) *Getter {
+	return &Getter{
+		nodeName: node.Name,
+		lister:   func() (*corev1.Node, error) { return node, nil },
+	}
+}
+
+func TestAuthoritativeIPsFromStatusAddresses(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeInternalIP, Address: "192.0.2.1"},
+				{Type: corev1.NodeInternalIP, Address: "2001:db8::1"},
+			},
+		},
+	}
+	ips, err := getterFor(node).AuthoritativeIPs()
+	if err != nil {
+		t.Fatalf("AuthoritativeIPs() error = %v", err)
+	}
+	if !ips.HasAll("192.0.2.1", "2001:db8::1") {
+		t.Errorf("AuthoritativeIPs() = %v, want both addresses", ips.List())
+	}
+}
+
+func TestAuthoritativeIPsFallsBackToOVNAnnotationWhenFamilyMissing(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node-b",
+			Annotations: map[string]string{
+				ovnPrimaryIfAddrAnnotation: `{"ipv4":"192.0.2.5/24","ipv6":"2001:db8::5/64"}`,
+			},
+		},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeInternalIP, Address: "192.0.2.1"},
+			},
+		},
+	}
+	ips, err := getterFor(node).AuthoritativeIPs()
+	if err != nil {
+		t.Fatalf("AuthoritativeIPs() error = %v", err)
+	}
+	if !ips.Has("192.0.2.1") {
+		t.Errorf("AuthoritativeIPs() = %v, want Status.Addresses IPv4 kept", ips.List())
+	}
+	if !ips.Has("2001:db8::5") {
+		t.Errorf("AuthoritativeIPs() = %v, want annotation IPv6 fallback added", ips.List())
+	}
+}
+
+func TestAuthoritativeIPsIgnoresAnnotationWhenBothFamiliesPresent(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node-c",
+			Annotations: map[string]string{
+				ovnPrimaryIfAddrAnnotation: `{"ipv4":"192.0.2.5/24","ipv6":"2001:db8::5/64"}`,
+			},
+		},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeInternalIP, Address: "192.0.2.1"},
+				{Type: corev1.NodeInternalIP, Address: "2001:db8::1"},
+			},
+		},
+	}
+	ips, err := getterFor(node).AuthoritativeIPs()
+	if err != nil {
+		t.Fatalf("AuthoritativeIPs() error = %v", err)
+	}
+	if ips.Has("192.0.2.5") || ips.Has("2001:db8::5") {
+		t.Errorf("AuthoritativeIPs() = %v, want annotation fallback not consulted", ips.List())
+	}
+}
@@ -0,0 +1,150 @@
+// Package watcher drives address-change detection off netlink
+// RTM_NEWADDR/RTM_DELADDR events instead of a fixed polling loop, so a
+// changed interface is reacted to within the kernel's own event latency
+// instead of whenever the next poll happens to land.
+package watcher
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog"
+)
+
+// Watcher maintains a live view of every interface's address set, seeded by
+// an initial dump and kept current by netlink address events.
+type Watcher struct {
+	mu             sync.RWMutex
+	addrsByIfindex map[int]sets.String
+	updates        chan netlink.AddrUpdate
+	done           chan struct{}
+}
+
+// New seeds a Watcher from the current address table.
+func New() (*Watcher, error) {
+	addrs, err := netlink.AddrList(nil, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, fmt.Errorf("watcher: could not list addresses: %v", err)
+	}
+	byIfindex := map[int]sets.String{}
+	for _, a := range addrs {
+		if byIfindex[a.LinkIndex] == nil {
+			byIfindex[a.LinkIndex] = sets.NewString()
+		}
+		byIfindex[a.LinkIndex].Insert(a.IPNet.IP.String())
+	}
+	return &Watcher{
+		addrsByIfindex: byIfindex,
+		updates:        make(chan netlink.AddrUpdate, 64),
+		done:           make(chan struct{}),
+	}, nil
+}
+
+// Run subscribes to RTM_NEWADDR/RTM_DELADDR and invokes onChange every time
+// an address is added or removed, plus once per fallbackInterval as a safety
+// net in case an event is ever missed. onChange runs on a dedicated worker
+// goroutine rather than inline: it can take much longer than an address
+// event does to arrive (e.g. it runs ARP/NDP probes), and netlink's own
+// read loop blocks sending into w.updates once its buffer fills, so the
+// event loop below must never block waiting on onChange to return. Runs
+// that arrive while onChange is still busy are coalesced into a single
+// pending run instead of queuing up. It blocks until stopCh is closed.
+func (w *Watcher) Run(stopCh <-chan struct{}, fallbackInterval time.Duration, onChange func()) error {
+	if err := netlink.AddrSubscribeWithOptions(w.updates, w.done, netlink.AddrSubscribeOptions{
+		ErrorCallback: func(err error) {
+			klog.Errorf("watcher: netlink subscription error: %v", err)
+		},
+	}); err != nil {
+		return fmt.Errorf("watcher: could not subscribe to address updates: %v", err)
+	}
+
+	trigger := make(chan struct{}, 1)
+	workerDone := make(chan struct{})
+	go func() {
+		defer close(workerDone)
+		for range trigger {
+			onChange()
+		}
+	}()
+	requestChange := func() {
+		select {
+		case trigger <- struct{}{}:
+		default: // a run is already pending; this event will be covered by it
+		}
+	}
+
+	ticker := time.NewTicker(fallbackInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			close(w.done)
+			close(trigger)
+			<-workerDone
+			return nil
+		case update := <-w.updates:
+			w.apply(update)
+			requestChange()
+		case <-ticker.C:
+			requestChange()
+		}
+	}
+}
+
+func (w *Watcher) apply(update netlink.AddrUpdate) {
+	ip := update.LinkAddress.IP.String()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.addrsByIfindex[update.LinkIndex] == nil {
+		w.addrsByIfindex[update.LinkIndex] = sets.NewString()
+	}
+	if update.NewAddr {
+		w.addrsByIfindex[update.LinkIndex].Insert(ip)
+	} else {
+		w.addrsByIfindex[update.LinkIndex].Delete(ip)
+	}
+}
+
+// Addresses returns every address currently tracked across all interfaces
+// that satisfies isValid, so callers can recompute their diff against the
+// maintained map instead of re-reading the interface list from the kernel.
+func (w *Watcher) Addresses(isValid func(net.IP) bool) sets.String {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	result := sets.NewString()
+	for _, addrs := range w.addrsByIfindex {
+		for _, s := range addrs.UnsortedList() {
+			if ip := net.ParseIP(s); ip != nil && isValid(ip) {
+				result.Insert(s)
+			}
+		}
+	}
+	return result
+}
+
+// InterfaceAddresses returns the addresses currently tracked for the named
+// interface that satisfy isValid.
+func (w *Watcher) InterfaceAddresses(name string, isValid func(net.IP) bool) (sets.String, error) {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("watcher: could not look up interface %s: %v", name, err)
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	result := sets.NewString()
+	for _, s := range w.addrsByIfindex[ifi.Index].UnsortedList() {
+		if ip := net.ParseIP(s); ip != nil && isValid(ip) {
+			result.Insert(s)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,109 @@
+package watcher
+
+import (
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func newTestWatcher() *Watcher {
+	return &Watcher{addrsByIfindex: map[int]sets.String{}}
+}
+
+func addrUpdate(ifindex int, ip string, newAddr bool) netlink.AddrUpdate {
+	return netlink.AddrUpdate{
+		LinkAddress: net.IPNet{IP: net.ParseIP(ip)},
+		LinkIndex:   ifindex,
+		NewAddr:     newAddr,
+	}
+}
+
+func TestApplyInsertsAndDeletes(t *testing.T) {
+	w := newTestWatcher()
+
+	w.apply(addrUpdate(2, "192.0.2.1", true))
+	if !w.addrsByIfindex[2].Has("192.0.2.1") {
+		t.Fatalf("addrsByIfindex[2] = %v, want it to contain 192.0.2.1", w.addrsByIfindex[2].List())
+	}
+
+	w.apply(addrUpdate(2, "192.0.2.2", true))
+	if !w.addrsByIfindex[2].HasAll("192.0.2.1", "192.0.2.2") {
+		t.Fatalf("addrsByIfindex[2] = %v, want both addresses", w.addrsByIfindex[2].List())
+	}
+
+	w.apply(addrUpdate(2, "192.0.2.1", false))
+	if w.addrsByIfindex[2].Has("192.0.2.1") {
+		t.Fatalf("addrsByIfindex[2] = %v, want 192.0.2.1 removed", w.addrsByIfindex[2].List())
+	}
+	if !w.addrsByIfindex[2].Has("192.0.2.2") {
+		t.Fatalf("addrsByIfindex[2] = %v, want 192.0.2.2 to remain", w.addrsByIfindex[2].List())
+	}
+}
+
+func TestApplyDeleteOnUnseenIfindexIsNoop(t *testing.T) {
+	w := newTestWatcher()
+	w.apply(addrUpdate(7, "192.0.2.9", false))
+	if w.addrsByIfindex[7].Len() != 0 {
+		t.Errorf("addrsByIfindex[7] = %v, want empty", w.addrsByIfindex[7].List())
+	}
+}
+
+func alwaysValid(net.IP) bool { return true }
+
+func TestAddressesAcrossInterfaces(t *testing.T) {
+	w := newTestWatcher()
+	w.apply(addrUpdate(1, "192.0.2.1", true))
+	w.apply(addrUpdate(2, "2001:db8::1", true))
+
+	got := w.Addresses(alwaysValid)
+	if !got.HasAll("192.0.2.1", "2001:db8::1") {
+		t.Errorf("Addresses() = %v, want both tracked addresses", got.List())
+	}
+}
+
+func TestAddressesFiltersByIsValid(t *testing.T) {
+	w := newTestWatcher()
+	w.apply(addrUpdate(1, "192.0.2.1", true))
+	w.apply(addrUpdate(1, "127.0.0.1", true))
+
+	notLoopback := func(ip net.IP) bool { return !ip.IsLoopback() }
+	got := w.Addresses(notLoopback)
+	if got.Has("127.0.0.1") {
+		t.Errorf("Addresses() = %v, want loopback filtered out", got.List())
+	}
+	if !got.Has("192.0.2.1") {
+		t.Errorf("Addresses() = %v, want 192.0.2.1 kept", got.List())
+	}
+}
+
+func TestInterfaceAddressesReturnsOnlyNamedInterface(t *testing.T) {
+	ifaces, err := net.Interfaces()
+	if err != nil || len(ifaces) == 0 {
+		t.Skip("no interfaces available to test against")
+	}
+	target := ifaces[0]
+
+	w := newTestWatcher()
+	w.apply(addrUpdate(target.Index, "192.0.2.1", true))
+	w.apply(addrUpdate(target.Index+1000, "192.0.2.2", true))
+
+	got, err := w.InterfaceAddresses(target.Name, alwaysValid)
+	if err != nil {
+		t.Fatalf("InterfaceAddresses() error = %v", err)
+	}
+	if !got.Has("192.0.2.1") {
+		t.Errorf("InterfaceAddresses(%s) = %v, want 192.0.2.1", target.Name, got.List())
+	}
+	if got.Has("192.0.2.2") {
+		t.Errorf("InterfaceAddresses(%s) = %v, want the other interface's address excluded", target.Name, got.List())
+	}
+}
+
+func TestInterfaceAddressesUnknownInterface(t *testing.T) {
+	w := newTestWatcher()
+	if _, err := w.InterfaceAddresses("no-such-iface-xyz", alwaysValid); err == nil {
+		t.Error("InterfaceAddresses() with an unknown interface returned nil error, want an error")
+	}
+}